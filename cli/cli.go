@@ -0,0 +1,36 @@
+// Package cli defines the per-vendor CLI behavior that conn uses to drive a session.
+package cli
+
+import (
+	"io"
+	"regexp"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHInitializer opens the stdin/stdout/session for a freshly dialed ssh.Client.
+type SSHInitializer func(client *ssh.Client) (io.Reader, io.WriteCloser, *ssh.Session, error)
+
+// Operator describes the vendor-specific CLI conventions (prompts, mode
+// transitions, line endings, error patterns) needed to drive a device session.
+type Operator interface {
+	// GetSSHInitializer returns the function used to open the ssh session.
+	GetSSHInitializer() SSHInitializer
+	// GetPrompts returns the prompt patterns expected in the given mode.
+	GetPrompts(mode string) []*regexp.Regexp
+	// GetErrPatterns returns patterns that indicate a command failed.
+	GetErrPatterns() []*regexp.Regexp
+	// GetLinebreak returns the line ending used to submit a command.
+	GetLinebreak() string
+	// GetTransitions returns the commands needed to move from one mode to another.
+	GetTransitions(from, to string) []string
+	// GetInterrupt returns the control sequence that returns the device to
+	// its prompt without tearing down the session, e.g. "\x03" for most
+	// Cisco-like CLIs or "q" to quit a pager. Used by ExecStream to recover
+	// the connection when its context is cancelled mid-command.
+	GetInterrupt() string
+	// GetVendor returns this Operator's vendor/device-type name (e.g.
+	// "cisco_ios"), used as a low-cardinality label on metrics instead of
+	// the individual device's address or name.
+	GetVendor() string
+}
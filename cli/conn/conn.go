@@ -2,25 +2,56 @@ package conn
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/sky-cloud-tec/netd/cli"
 	"github.com/sky-cloud-tec/netd/protocol"
-	"github.com/songtianyi/rrframework/logs"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sky-cloud-tec/netd/common"
+	"github.com/sky-cloud-tec/netd/metrics"
+	"github.com/sky-cloud-tec/netd/registry"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 
 	"github.com/ziutek/telnet"
 )
 
+// connLeaseTTL is how long this node's registry claim on a device address
+// is valid for before it must be refreshed by heartbeat().
+const connLeaseTTL = 90 * time.Second
+
 var (
+	mu    sync.Mutex
 	conns map[string]*CliConn
 	semas map[string]chan struct{}
+
+	// reg tracks which node owns the active connection to a device
+	// address. It defaults to an in-process registry; SetRegistry swaps it
+	// for a shared one (e.g. Redis) so the "one active request per device"
+	// invariant holds across a fleet of netd instances.
+	reg registry.Registry = registry.NewInMemory()
+
+	// sessionSeq hands out the session_id log field for each new CliConn.
+	sessionSeq uint64
+
+	// met reports connection pool health and command latency. It defaults
+	// to the process-wide Prometheus registry; SetMetrics swaps it for an
+	// injected one, e.g. in tests. It reflects the true live state of
+	// conns even when reg is a distributed registry.Registry, since
+	// ownership and local connection pooling are tracked separately.
+	met = metrics.New(prometheus.DefaultRegisterer)
 )
 
 func init() {
@@ -28,12 +59,32 @@ func init() {
 	semas = make(map[string]chan struct{}, 0)
 }
 
+// SetRegistry replaces the connection-ownership registry, e.g. with a
+// registry.Redis so multiple netd instances can coordinate access to the
+// same devices.
+func SetRegistry(r registry.Registry) {
+	reg = r
+}
+
+// SetMetrics replaces the collectors CliConn reports against, e.g. with a
+// *metrics.Metrics built against a private prometheus.Registerer in tests.
+func SetMetrics(m *metrics.Metrics) {
+	met = m
+}
+
 // CliConn cli connection
 type CliConn struct {
-	t    int                  // connection type 0 = ssh, 1 = telnet
-	mode string               // device cli mode
-	req  *protocol.CliRequest // cli request
-	op   cli.Operator         // cli operator
+	t         int                  // connection type 0 = ssh, 1 = telnet
+	mode      string               // device cli mode
+	req       *protocol.CliRequest // cli request
+	op        cli.Operator         // cli operator
+	sessionID string               // stable id for the life of this connection
+
+	// log is swapped out by refreshLog whenever Acquire reuses this
+	// connection for a new request, concurrently with heartbeat() reading
+	// it on every tick independent of sema ownership, so it's held behind
+	// an atomic.Pointer rather than a bare field.
+	log atomic.Pointer[logrus.Entry]
 
 	conn   *telnet.Conn // telnet connection
 	client *ssh.Client  // ssh client
@@ -41,104 +92,382 @@ type CliConn struct {
 	session *ssh.Session   // ssh session
 	r       io.Reader      // ssh session stdout
 	w       io.WriteCloser // ssh session stdin
+
+	// bastions holds the chain of SSH jump-host clients used to reach
+	// Address, in dial order. Empty when the device is reached directly.
+	// They're kept alive for the life of the connection and closed, in
+	// reverse order, by Close().
+	bastions []*ssh.Client
+}
+
+// refreshLog rebuilds s.log from the current request, keeping sessionID
+// stable across requests that reuse this connection but updating req_id and
+// mode so every log line can be correlated back to the request that caused
+// it.
+func (s *CliConn) refreshLog(req *protocol.CliRequest) {
+	s.log.Store(logrus.WithFields(logrus.Fields{
+		"device":     req.Device,
+		"address":    req.Address,
+		"protocol":   req.Protocol,
+		"mode":       s.mode,
+		"session_id": s.sessionID,
+		"req_id":     req.ReqID,
+	}))
+}
+
+// logger returns the current structured logger for this connection. It's an
+// atomic load rather than a direct field read because refreshLog can swap
+// the logger concurrently with heartbeat(), which reads it independent of
+// sema ownership.
+func (s *CliConn) logger() *logrus.Entry {
+	return s.log.Load()
+}
+
+func requestLog(req *protocol.CliRequest) *logrus.Entry {
+	return logrus.WithFields(logrus.Fields{
+		"device":   req.Device,
+		"address":  req.Address,
+		"protocol": req.Protocol,
+		"mode":     req.Mode,
+		"req_id":   req.ReqID,
+	})
 }
 
 // Acquire cli conn
 func Acquire(req *protocol.CliRequest, op cli.Operator) (*CliConn, error) {
-	// limit concurrency to 1
+	log := requestLog(req)
+	// limit concurrency to 1 within this process
 	// there only one req for one connection always
-	logs.Debug(req.LogPrefix, "Acquiring sema...")
+	log.Debug("acquiring sema")
+	mu.Lock()
 	if semas[req.Address] == nil {
 		semas[req.Address] = make(chan struct{}, 1)
 	}
+	sema := semas[req.Address]
+	mu.Unlock()
 	// try
-	semas[req.Address] <- struct{}{}
-	logs.Debug(req.LogPrefix, "sema acquired")
+	waitStart := time.Now()
+	sema <- struct{}{}
+	met.SemaWait.Observe(time.Since(waitStart).Seconds())
+	log.Debug("sema acquired")
+
+	// also claim ownership in the registry, so a second netd instance
+	// pointed at the same device backs off instead of racing this one
+	ok, owner, err := reg.Acquire(req.Address, common.NodeID, connLeaseTTL)
+	if err != nil {
+		<-sema
+		return nil, fmt.Errorf("%s registry acquire error, %s", req.LogPrefix, err)
+	}
+	if !ok {
+		<-sema
+		return nil, fmt.Errorf("%s connection to %s is owned by %s", req.LogPrefix, req.Address, owner)
+	}
+
 	// if cli conn already created
+	mu.Lock()
 	if v, ok := conns[req.Address]; ok {
 		v.req = req
 		v.op = op
-		logs.Debug(req.LogPrefix, "cli conn exist")
+		v.refreshLog(req)
+		mu.Unlock()
+		v.logger().Debug("cli conn exist")
 		return v, nil
 	}
+	mu.Unlock()
+
+	// dialing is blocking network I/O (and, with a proxy chain, a sequence
+	// of bastion dials), so it must happen outside mu: req.Address's sema,
+	// acquired above, already keeps this from racing another Acquire for
+	// the same address, and mu only needs to be held long enough to publish
+	// the result so other addresses aren't stalled behind this dial.
 	c, err := newCliConn(req, op)
 	if err != nil {
+		// no *CliConn was ever handed back, so Release will never be called
+		// for this acquire: release the sema and registry lease ourselves,
+		// or they'd stay held (the lease for the full connLeaseTTL) for an
+		// address this node just failed to reach.
+		<-sema
+		if relErr := reg.Release(req.Address, common.NodeID); relErr != nil {
+			log.WithError(relErr).Warn("registry release after dial failure error")
+		}
 		return nil, err
 	}
+	mu.Lock()
 	conns[req.Address] = c
+	mu.Unlock()
 	return c, nil
 }
 
 // Release cli conn
 func Release(req *protocol.CliRequest) {
-	if len(semas[req.Address]) > 0 {
-		logs.Debug(req.LogPrefix, "Releasing sema")
-		<-semas[req.Address]
+	log := requestLog(req)
+	mu.Lock()
+	sema := semas[req.Address]
+	mu.Unlock()
+	if len(sema) > 0 {
+		log.Debug("releasing sema")
+		<-sema
 	}
-	logs.Debug(req.LogPrefix, "sema released")
+	log.Debug("sema released")
 }
 
 func newCliConn(req *protocol.CliRequest, op cli.Operator) (*CliConn, error) {
-	logs.Debug(req.LogPrefix, "creating cli conn...")
+	log := requestLog(req)
+	log.Debug("creating cli conn...")
+	sessionID := strconv.FormatUint(atomic.AddUint64(&sessionSeq, 1), 10)
+	var bastions []*ssh.Client
+	if len(req.Proxy) > 0 {
+		var err error
+		bastions, err = dialProxyChain(req.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%s dial proxy chain error, %s", req.LogPrefix, err)
+		}
+	}
 	if strings.ToLower(req.Protocol) == "ssh" {
+		authMethods, err := sshAuthMethods(req.Auth)
+		if err != nil {
+			closeBastions(bastions)
+			return nil, fmt.Errorf("%s build auth methods error, %s", req.LogPrefix, err)
+		}
+		hostKeyCallback, err := sshHostKeyCallback(req.Auth)
+		if err != nil {
+			closeBastions(bastions)
+			return nil, fmt.Errorf("%s build host key callback error, %s", req.LogPrefix, err)
+		}
 		sshConfig := &ssh.ClientConfig{
 			User:            req.Auth.Username,
-			Auth:            []ssh.AuthMethod{ssh.Password(req.Auth.Password)},
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Auth:            authMethods,
+			HostKeyCallback: hostKeyCallback,
 			Timeout:         5 * time.Second,
 		}
 		sshConfig.SetDefaults()
 		sshConfig.Ciphers = append(sshConfig.Ciphers, "aes128-cbc")
-		client, err := ssh.Dial("tcp", req.Address, sshConfig)
+		client, err := dialSSHTarget(req.Address, sshConfig, bastions)
 		if err != nil {
-			logs.Error(req.LogPrefix, "dial", req.Address, "error", err)
+			log.WithError(err).Error("dial failed")
+			closeBastions(bastions)
 			return nil, fmt.Errorf("%s dial %s error, %s", req.LogPrefix, req.Address, err)
 		}
-		c := &CliConn{t: common.SSHConn, client: client, req: req, op: op, mode: "login"}
+		c := &CliConn{t: common.SSHConn, client: client, bastions: bastions, req: req, op: op, mode: "login", sessionID: sessionID}
+		c.refreshLog(req)
+		met.OpenConnections.WithLabelValues(req.Protocol, op.GetVendor()).Inc()
 		if err := c.init(); err != nil {
 			c.Close()
 			return nil, err
 		}
 		return c, nil
 	} else if strings.ToLower(req.Protocol) == "telnet" {
-		conn, err := telnet.DialTimeout("tcp", req.Address, 5*time.Second)
+		var (
+			conn *telnet.Conn
+			err  error
+		)
+		if len(bastions) > 0 {
+			last := bastions[len(bastions)-1]
+			raw, dialErr := last.Dial("tcp", req.Address)
+			if dialErr != nil {
+				closeBastions(bastions)
+				return nil, fmt.Errorf("[ %s ] dial %s through bastion error, %s", req.Device, req.Address, dialErr)
+			}
+			conn, err = telnet.NewConn(raw)
+		} else {
+			conn, err = telnet.DialTimeout("tcp", req.Address, 5*time.Second)
+		}
 		if err != nil {
+			closeBastions(bastions)
 			return nil, fmt.Errorf("[ %s ] dial %s error, %s", req.Device, req.Address, err)
 		}
-		c := &CliConn{t: common.TELNETConn, conn: conn, req: req, op: op, mode: "login"}
+		c := &CliConn{t: common.TELNETConn, conn: conn, bastions: bastions, req: req, op: op, mode: "login", sessionID: sessionID}
+		c.refreshLog(req)
+		met.OpenConnections.WithLabelValues(req.Protocol, op.GetVendor()).Inc()
 		return c, nil
 	}
+	closeBastions(bastions)
 	return nil, fmt.Errorf("protocol %s not support", req.Protocol)
 }
 
+// dialProxyChain dials each SSH jump host in turn, using the previous hop's
+// client to reach the next, so the returned clients form a chain from the
+// netd process down to the last hop in front of the target device.
+func dialProxyChain(hops []*protocol.Proxy) ([]*ssh.Client, error) {
+	clients := make([]*ssh.Client, 0, len(hops))
+	for i, hop := range hops {
+		if hop.Protocol != "" && strings.ToLower(hop.Protocol) != "ssh" {
+			closeBastions(clients)
+			return nil, fmt.Errorf("hop %d protocol %s not supported, jump hosts must be ssh", i, hop.Protocol)
+		}
+		authMethods, err := sshAuthMethods(hop.Auth)
+		if err != nil {
+			closeBastions(clients)
+			return nil, fmt.Errorf("hop %d build auth methods error, %s", i, err)
+		}
+		hostKeyCallback, err := sshHostKeyCallback(hop.Auth)
+		if err != nil {
+			closeBastions(clients)
+			return nil, fmt.Errorf("hop %d build host key callback error, %s", i, err)
+		}
+		cfg := &ssh.ClientConfig{
+			User:            hop.Auth.Username,
+			Auth:            authMethods,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         5 * time.Second,
+		}
+		cfg.SetDefaults()
+		client, err := dialSSHTarget(hop.Address, cfg, clients)
+		if err != nil {
+			closeBastions(clients)
+			return nil, fmt.Errorf("hop %d dial %s error, %s", i, hop.Address, err)
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// dialSSHTarget dials address directly when bastions is empty, or through
+// the last client in bastions otherwise.
+func dialSSHTarget(address string, cfg *ssh.ClientConfig, bastions []*ssh.Client) (*ssh.Client, error) {
+	if len(bastions) == 0 {
+		return ssh.Dial("tcp", address, cfg)
+	}
+	last := bastions[len(bastions)-1]
+	conn, err := last.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, address, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// closeBastions tears down a proxy chain in reverse dial order.
+func closeBastions(bastions []*ssh.Client) {
+	for i := len(bastions) - 1; i >= 0; i-- {
+		bastions[i].Close()
+	}
+}
+
+// sshAuthMethods builds the ssh.AuthMethod slice from whichever credentials
+// the request supplies, trying password, then private key, then agent.
+func sshAuthMethods(auth *protocol.Auth) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if auth.Password != "" {
+		methods = append(methods, ssh.Password(auth.Password))
+	}
+	if auth.PrivateKey != "" {
+		var (
+			signer ssh.Signer
+			err    error
+		)
+		if auth.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(auth.PrivateKey), []byte(auth.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(auth.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse private key error, %s", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if auth.AgentSocket != "" {
+		conn, err := net.Dial("unix", auth.AgentSocket)
+		if err != nil {
+			return nil, fmt.Errorf("dial ssh agent %s error, %s", auth.AgentSocket, err)
+		}
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no usable auth method in request, need password, private key or agent socket")
+	}
+	return methods, nil
+}
+
+// sshHostKeyCallback builds the host key verification callback. A
+// KnownHostsFile takes precedence, then a pinned Fingerprint, falling back to
+// InsecureIgnoreHostKey only when StrictHostKey is false so operators can
+// migrate gradually.
+func sshHostKeyCallback(auth *protocol.Auth) (ssh.HostKeyCallback, error) {
+	if auth.KnownHostsFile != "" {
+		cb, err := knownhosts.New(auth.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("load known_hosts %s error, %s", auth.KnownHostsFile, err)
+		}
+		return cb, nil
+	}
+	if auth.Fingerprint != "" {
+		want := auth.Fingerprint
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			got := ssh.FingerprintSHA256(key)
+			if got != want {
+				return fmt.Errorf("host key fingerprint mismatch for %s, got %s, want %s", hostname, got, want)
+			}
+			return nil
+		}, nil
+	}
+	if auth.StrictHostKey {
+		return nil, fmt.Errorf("strict host key checking requires a known_hosts file or pinned fingerprint")
+	}
+	return ssh.InsecureIgnoreHostKey(), nil
+}
+
 func (s *CliConn) heartbeat() {
 	go func() {
 		tick := time.Tick(30 * time.Second)
 		for {
 			select {
 			case <-tick:
+				if err := s.checkBastions(); err != nil {
+					met.HeartbeatFailures.WithLabelValues(s.op.GetVendor()).Inc()
+					s.logger().WithError(err).Error("bastion-side drop detected")
+					s.Close()
+					return
+				}
+				mu.Lock()
+				sema := semas[s.req.Address]
+				mu.Unlock()
 				// try
-				logs.Info(s.req.LogPrefix, "Acquiring heartbeat sema...")
-				semas[s.req.Address] <- struct{}{}
-				logs.Info(s.req.LogPrefix, "heartbeat sema acquired")
+				s.logger().Info("acquiring heartbeat sema")
+				sema <- struct{}{}
+				s.logger().Info("heartbeat sema acquired")
 				if _, err := s.writeBuff(""); err != nil {
-					semas[s.req.Address] <- struct{}{}
-					logs.Critical(s.req.LogPrefix, "heartbeat error,", err)
+					sema <- struct{}{}
+					met.HeartbeatFailures.WithLabelValues(s.op.GetVendor()).Inc()
+					s.logger().WithError(err).Error("heartbeat error")
 					s.Close()
 					return
 				}
 				if _, _, err := s.readBuff(); err != nil {
-					semas[s.req.Address] <- struct{}{}
-					logs.Critical(s.req.LogPrefix, "heartbeat error,", err)
+					sema <- struct{}{}
+					met.HeartbeatFailures.WithLabelValues(s.op.GetVendor()).Inc()
+					s.logger().WithError(err).Error("heartbeat error")
+					s.Close()
+					return
+				}
+				if err := reg.Heartbeat(s.req.Address, common.NodeID, connLeaseTTL); err != nil {
+					met.HeartbeatFailures.WithLabelValues(s.op.GetVendor()).Inc()
+					s.logger().WithError(err).Error("registry heartbeat error")
+					<-sema
 					s.Close()
 					return
 				}
-				<-semas[s.req.Address]
+				<-sema
 			}
 		}
 	}()
 }
 
+// checkBastions pings every jump host in the chain with a keepalive global
+// request, so a bastion that dropped the connection is noticed even if the
+// target session itself still looks alive.
+func (s *CliConn) checkBastions() error {
+	for _, b := range s.bastions {
+		if _, _, err := b.SendRequest("keepalive@netd", true, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *CliConn) init() error {
 	if s.t == common.SSHConn {
 		f := s.op.GetSSHInitializer()
@@ -159,10 +488,17 @@ func (s *CliConn) init() error {
 
 // Close cli conn
 func (s *CliConn) Close() error {
+	mu.Lock()
 	delete(conns, s.req.Address)
+	mu.Unlock()
+	met.OpenConnections.WithLabelValues(s.req.Protocol, s.op.GetVendor()).Dec()
+	if err := reg.Release(s.req.Address, common.NodeID); err != nil {
+		s.logger().WithError(err).Warn("registry release error")
+	}
+	defer closeBastions(s.bastions)
 	if s.t == common.TELNETConn {
 		if s.conn == nil {
-			logs.Info("telnet conn nil when close")
+			s.logger().Info("telnet conn nil when close")
 			return nil
 		}
 		return s.conn.Close()
@@ -172,10 +508,10 @@ func (s *CliConn) Close() error {
 			return err
 		}
 	} else {
-		logs.Notice("ssh session nil when close")
+		s.logger().Warn("ssh session nil when close")
 	}
 	if s.client == nil {
-		logs.Notice("ssh conn nil when close")
+		s.logger().Warn("ssh conn nil when close")
 		return nil
 	}
 	return s.client.Close()
@@ -214,7 +550,7 @@ func (s *CliConn) findLastLine(t string) string {
 func (s *CliConn) anyPatternMatches(t string, patterns []*regexp.Regexp) []string {
 	for _, v := range patterns {
 		matches := v.FindStringSubmatch(t)
-		logs.Debug(v, t, matches)
+		s.logger().WithField("pattern", v).Debug(t, matches)
 		if len(matches) != 0 {
 			return matches
 		}
@@ -231,17 +567,18 @@ func (s *CliConn) readLines() *readBuffOut {
 		n, err := s.read(buf) //this reads the ssh/telnet terminal
 		if err != nil {
 			// something wrong
-			logs.Error(s.req.LogPrefix, "io.Reader read error,", err)
+			s.logger().WithError(err).Error("io.Reader read error")
 			break
 		}
 		// for every line
 		current := string(buf[:n])
-		logs.Debug(s.req.LogPrefix, "(", n, ")", current)
+		s.logger().Debugf("(%d) %s", n, current)
 		lastLine = s.findLastLine(waitingString + current)
-		logs.Debug("lastline:", lastLine, ":")
+		s.logger().Debugf("lastline: %s :", lastLine)
 		matches := s.anyPatternMatches(lastLine, s.op.GetPrompts(s.mode))
 		if len(matches) > 0 {
-			logs.Info(s.req.LogPrefix, "[prompt matched]", matches)
+			met.PatternMatches.WithLabelValues("prompt").Inc()
+			s.logger().WithField("matches", matches).Info("prompt matched")
 			waitingString = strings.TrimSuffix(waitingString+current, matches[0])
 			break
 		}
@@ -271,7 +608,8 @@ func (s *CliConn) readBuff() (string, string, error) {
 			for scanner.Scan() {
 				matches := s.anyPatternMatches(scanner.Text(), s.op.GetErrPatterns())
 				if len(matches) > 0 {
-					logs.Info(s.req.LogPrefix, "err pattern matched,", matches)
+					met.PatternMatches.WithLabelValues("err").Inc()
+					s.logger().WithField("matches", matches).Info("err pattern matched")
 					return "", res.prompt, fmt.Errorf("err pattern matched, %s", matches)
 				}
 			}
@@ -282,10 +620,110 @@ func (s *CliConn) readBuff() (string, string, error) {
 	}
 }
 
+// readLinesStream reads cmd's output like readLines, but pushes each partial
+// read to out as a protocol.CliChunk instead of accumulating it, and always
+// finishes by pushing a Done chunk (with Err set if reading failed). If ctx
+// is cancelled before the prompt matches, it sends the device's interrupt
+// sequence and waits up to req.Timeout for the prompt to reappear so the
+// connection isn't left poisoned for the next command.
+//
+// Once readLinesStream returns, the caller may stop draining out, so the
+// background reader goroutine selects on stop before every send to out
+// instead of blocking on it forever.
+func (s *CliConn) readLinesStream(ctx context.Context, cmd string, out chan<- protocol.CliChunk) error {
+	buf := make([]byte, 1000)
+	var waitingString, lastLine string
+	done := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		for {
+			n, err := s.read(buf)
+			if err != nil {
+				s.logger().WithError(err).Error("io.Reader read error")
+				done <- err
+				return
+			}
+			current := string(buf[:n])
+			s.logger().Debugf("(%d) %s", n, current)
+			select {
+			case out <- protocol.CliChunk{Cmd: cmd, Data: current}:
+			case <-stop:
+				return
+			}
+			waitingString += current
+			lastLine = s.findLastLine(waitingString)
+			matches := s.anyPatternMatches(lastLine, s.op.GetPrompts(s.mode))
+			if len(matches) > 0 {
+				met.PatternMatches.WithLabelValues("prompt").Inc()
+				s.logger().WithField("matches", matches).Info("prompt matched")
+				// check every output line for err patterns, as readBuff does
+				scanner := bufio.NewScanner(strings.NewReader(strings.TrimSuffix(waitingString, matches[0])))
+				for scanner.Scan() {
+					if m := s.anyPatternMatches(scanner.Text(), s.op.GetErrPatterns()); len(m) > 0 {
+						met.PatternMatches.WithLabelValues("err").Inc()
+						s.logger().WithField("matches", m).Info("err pattern matched")
+						done <- fmt.Errorf("err pattern matched, %s", m)
+						return
+					}
+				}
+				done <- nil
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-done:
+		out <- protocol.CliChunk{Cmd: cmd, Done: true, Err: errString(err)}
+		return err
+	case <-ctx.Done():
+		s.logger().WithField("cmd", cmd).Info("context cancelled, sending interrupt")
+		if err := s.writeInterrupt(s.req.Timeout); err != nil {
+			out <- protocol.CliChunk{Cmd: cmd, Done: true, Err: err.Error()}
+			return fmt.Errorf("write interrupt failed, %s", err)
+		}
+		select {
+		case <-done:
+		case <-time.After(s.req.Timeout):
+			s.logger().WithField("cmd", cmd).Warn("device did not return to prompt after interrupt")
+		}
+		out <- protocol.CliChunk{Cmd: cmd, Done: true, Err: ctx.Err().Error()}
+		return ctx.Err()
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
 func (s *CliConn) writeBuff(cmd string) (int, error) {
 	return s.write([]byte(cmd + s.op.GetLinebreak()))
 }
 
+// writeInterrupt sends the vendor interrupt sequence, bounded by timeout. A
+// device that's stopped reading (the stuck-pager/monitor case this recovers
+// from) could otherwise block the write forever, same as an unbounded read;
+// on timeout the write is abandoned and its goroutine left to finish (or not)
+// on its own, the same tradeoff readBuff already makes on its read side.
+func (s *CliConn) writeInterrupt(timeout time.Duration) error {
+	ch := make(chan error, 1)
+	go func() {
+		_, err := s.write([]byte(s.op.GetInterrupt()))
+		ch <- err
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("write interrupt timeout after %q", timeout)
+	}
+}
+
 // Exec execute cli cmds
 func (s *CliConn) Exec() (map[string]string, error) {
 	// transit to target mode
@@ -295,12 +733,12 @@ func (s *CliConn) Exec() (map[string]string, error) {
 		s.mode = s.req.Mode
 		for _, v := range cmds {
 			if _, err := s.writeBuff(v); err != nil {
-				logs.Error(s.req.LogPrefix, "write buff failed,", err)
+				s.logger().WithError(err).Error("write buff failed")
 				return nil, fmt.Errorf("write buff failed, %s", err)
 			}
 			_, _, err := s.readBuff()
 			if err != nil {
-				logs.Error(s.req.LogPrefix, "readBuff failed,", err)
+				s.logger().WithError(err).Error("readBuff failed")
 				return nil, fmt.Errorf("readBuff failed, %s", err)
 			}
 		}
@@ -308,16 +746,58 @@ func (s *CliConn) Exec() (map[string]string, error) {
 	cmdstd := make(map[string]string, 0)
 	// do execute cli commands
 	for _, v := range s.req.Commands {
+		start := time.Now()
 		if _, err := s.writeBuff(v); err != nil {
-			logs.Error(s.req.LogPrefix, "write buff failed,", err)
+			s.logger().WithError(err).Error("write buff failed")
 			return cmdstd, fmt.Errorf("write buff failed, %s", err)
 		}
 		ret, _, err := s.readBuff()
 		if err != nil {
-			logs.Error(s.req.LogPrefix, "readBuff failed,", err)
+			s.logger().WithError(err).Error("readBuff failed")
 			return cmdstd, fmt.Errorf("readBuff failed, %s", err)
 		}
+		met.ExecLatency.WithLabelValues(s.op.GetVendor(), s.req.Mode).Observe(time.Since(start).Seconds())
 		cmdstd[v] = ret
 	}
 	return cmdstd, nil
-}
\ No newline at end of file
+}
+
+// ExecStream runs req.Commands like Exec, but streams each command's output
+// to out as it's read instead of buffering the whole response, so commands
+// like "show tech-support" or vendor "monitor" commands don't have to finish
+// before anything is returned. It returns once every command's prompt has
+// matched, or once ctx is cancelled during a command. On cancellation it
+// sends the device's interrupt sequence and waits up to req.Timeout for the
+// prompt to reappear, so the session returns to its prompt cleanly and stays
+// usable for the next Acquire.
+func (s *CliConn) ExecStream(ctx context.Context, out chan<- protocol.CliChunk) error {
+	// transit to target mode
+	if s.req.Mode != s.mode {
+		cmds := s.op.GetTransitions(s.mode, s.req.Mode)
+		// use target mode prompt
+		s.mode = s.req.Mode
+		for _, v := range cmds {
+			if _, err := s.writeBuff(v); err != nil {
+				s.logger().WithError(err).Error("write buff failed")
+				return fmt.Errorf("write buff failed, %s", err)
+			}
+			if _, _, err := s.readBuff(); err != nil {
+				s.logger().WithError(err).Error("readBuff failed")
+				return fmt.Errorf("readBuff failed, %s", err)
+			}
+		}
+	}
+	for _, v := range s.req.Commands {
+		start := time.Now()
+		if _, err := s.writeBuff(v); err != nil {
+			s.logger().WithError(err).Error("write buff failed")
+			return fmt.Errorf("write buff failed, %s", err)
+		}
+		if err := s.readLinesStream(ctx, v, out); err != nil {
+			s.logger().WithError(err).Error("readLinesStream failed")
+			return fmt.Errorf("readLinesStream failed, %s", err)
+		}
+		met.ExecLatency.WithLabelValues(s.op.GetVendor(), s.req.Mode).Observe(time.Since(start).Seconds())
+	}
+	return nil
+}
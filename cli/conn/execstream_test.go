@@ -0,0 +1,176 @@
+package conn
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sky-cloud-tec/netd/cli"
+	"github.com/sky-cloud-tec/netd/common"
+	"github.com/sky-cloud-tec/netd/protocol"
+)
+
+// testOperator is a minimal cli.Operator for exercising readLinesStream
+// without a real device.
+type testOperator struct {
+	prompts   []*regexp.Regexp
+	errs      []*regexp.Regexp
+	interrupt string
+}
+
+func (o *testOperator) GetSSHInitializer() cli.SSHInitializer   { return nil }
+func (o *testOperator) GetPrompts(mode string) []*regexp.Regexp { return o.prompts }
+func (o *testOperator) GetErrPatterns() []*regexp.Regexp        { return o.errs }
+func (o *testOperator) GetLinebreak() string                    { return "\n" }
+func (o *testOperator) GetTransitions(from, to string) []string { return nil }
+func (o *testOperator) GetInterrupt() string                    { return o.interrupt }
+func (o *testOperator) GetVendor() string                       { return "test_vendor" }
+
+func newTestConn(op cli.Operator, timeout time.Duration) (*CliConn, net.Conn) {
+	clientConn, deviceConn := net.Pipe()
+	s := &CliConn{
+		t:    common.SSHConn,
+		mode: "en",
+		r:    clientConn,
+		w:    clientConn,
+		op:   op,
+		req:  &protocol.CliRequest{Timeout: timeout},
+	}
+	s.log.Store(logrus.NewEntry(logrus.New()))
+	return s, deviceConn
+}
+
+// TestReadLinesStreamErrPatternSurfacesAsError checks that, like Exec's
+// readBuff, a streamed command whose output matches GetErrPatterns is
+// reported as an error once the prompt reappears.
+func TestReadLinesStreamErrPatternSurfacesAsError(t *testing.T) {
+	op := &testOperator{
+		prompts: []*regexp.Regexp{regexp.MustCompile(`^Router#$`)},
+		errs:    []*regexp.Regexp{regexp.MustCompile(`% Invalid input`)},
+	}
+	s, device := newTestConn(op, time.Second)
+	defer device.Close()
+
+	go func() {
+		device.Write([]byte("% Invalid input\n"))
+		device.Write([]byte("Router#"))
+	}()
+
+	out := make(chan protocol.CliChunk, 16)
+	err := s.readLinesStream(context.Background(), "bogus command", out)
+	if err == nil {
+		t.Fatal("readLinesStream error = nil, want err pattern match error")
+	}
+
+	var sawDone bool
+	for {
+		select {
+		case chunk := <-out:
+			if chunk.Done {
+				sawDone = true
+				if chunk.Err == "" {
+					t.Fatal("Done chunk has no Err, want err pattern match reported")
+				}
+			}
+		default:
+			if !sawDone {
+				t.Fatal("never saw a Done chunk")
+			}
+			return
+		}
+	}
+}
+
+// TestReadLinesStreamInterruptDoesNotLeakGoroutine covers the cancellation
+// path the request added ExecStream for: the device never returns to a
+// prompt (e.g. it's stuck in a pager or a "monitor" style command), so
+// readLinesStream gives up after req.Timeout following the interrupt. Once
+// it returns and its caller stops draining out, the background reader
+// goroutine must not be left running forever.
+func TestReadLinesStreamInterruptDoesNotLeakGoroutine(t *testing.T) {
+	op := &testOperator{interrupt: "\x03"} // no prompts configured: never matches
+	s, device := newTestConn(op, 30*time.Millisecond)
+	defer device.Close()
+
+	stopDevice := make(chan struct{})
+	deviceDone := make(chan struct{})
+	go func() {
+		defer close(deviceDone)
+		// The device both keeps writing output (so readLinesStream never
+		// sees a prompt match) and drains whatever comes back, the way a
+		// real device reads the interrupt byte off the wire even while it's
+		// still producing output.
+		drain := make([]byte, 64)
+		for {
+			select {
+			case <-stopDevice:
+				return
+			default:
+			}
+			if _, err := device.Write([]byte("x")); err != nil {
+				return
+			}
+			device.SetReadDeadline(time.Now().Add(time.Millisecond))
+			if _, err := device.Read(drain); err != nil && !isTimeout(err) {
+				return
+			}
+		}
+	}()
+
+	out := make(chan protocol.CliChunk)
+	consumerStop := make(chan struct{})
+	consumerDone := make(chan struct{})
+	baseline := runtime.NumGoroutine()
+	go func() {
+		defer close(consumerDone)
+		for {
+			select {
+			case <-out:
+			case <-consumerStop:
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.readLinesStream(ctx, "show tech-support", out) }()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-time.After(time.Second):
+		t.Fatal("readLinesStream did not return within 1s of ctx cancellation")
+	}
+	if err != context.Canceled {
+		t.Fatalf("readLinesStream error = %v, want context.Canceled", err)
+	}
+
+	// Simulate the caller moving on, the way ExecStream/stream.Handler would
+	// once the command's Done chunk has been observed.
+	close(consumerStop)
+	<-consumerDone
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("background reader goroutine leaked: NumGoroutine %d > baseline %d", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stopDevice)
+	device.Close()
+	<-deviceDone
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
@@ -0,0 +1,25 @@
+// Package common holds constants shared across the cli connection layer.
+package common
+
+import (
+	"fmt"
+	"os"
+)
+
+// connection types
+const (
+	SSHConn = iota
+	TELNETConn
+)
+
+// NodeID identifies this process when claiming ownership of a device
+// connection in a distributed registry. It is derived once at startup.
+var NodeID = makeNodeID()
+
+func makeNodeID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
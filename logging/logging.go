@@ -0,0 +1,43 @@
+// Package logging configures the structured logger used across netd so
+// per-session fields (device, address, session_id, req_id, ...) ship as
+// machine-parseable events instead of free-form strings.
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config controls the format and verbosity of the process-wide logger.
+type Config struct {
+	// Format is "json" or "text". Defaults to "text".
+	Format string
+	// Level is a logrus level name, e.g. "debug", "info", "warning".
+	// Defaults to "info".
+	Level string
+}
+
+// Configure applies cfg to the standard logrus logger. Call it once at
+// startup before any CliConn is created.
+func Configure(cfg Config) error {
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	case "", "text":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	default:
+		return fmt.Errorf("logging: unknown format %q", cfg.Format)
+	}
+	if cfg.Level == "" {
+		logrus.SetLevel(logrus.InfoLevel)
+		return nil
+	}
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return fmt.Errorf("logging: %s", err)
+	}
+	logrus.SetLevel(level)
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package metrics registers the Prometheus collectors that expose
+// connection-pool health and command latency for the cli/conn package.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics bundles the collectors CliConn reports against. Tests (or
+// alternate entrypoints) can build their own via New with a private
+// Registerer instead of relying on the process-wide default.
+type Metrics struct {
+	// OpenConnections is the number of currently open device connections,
+	// partitioned by protocol and device vendor.
+	OpenConnections *prometheus.GaugeVec
+	// HeartbeatFailures counts heartbeat failures by device vendor.
+	HeartbeatFailures *prometheus.CounterVec
+	// ExecLatency is the per-command Exec latency, labeled by device vendor
+	// and cli mode.
+	ExecLatency *prometheus.HistogramVec
+	// PatternMatches counts prompt/err-pattern matches by kind ("prompt"
+	// or "err").
+	PatternMatches *prometheus.CounterVec
+	// SemaWait is the time spent waiting to acquire the per-address
+	// concurrency semaphore, so operators can see queueing under load. It
+	// isn't labeled by address: with one device per address, that label
+	// would grow unbounded with fleet size.
+	SemaWait prometheus.Histogram
+}
+
+// New builds a Metrics and registers its collectors with reg.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		OpenConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "netd",
+			Name:      "open_connections",
+			Help:      "Number of currently open device connections.",
+		}, []string{"protocol", "vendor"}),
+		HeartbeatFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "netd",
+			Name:      "heartbeat_failures_total",
+			Help:      "Number of heartbeat failures, by device vendor.",
+		}, []string{"vendor"}),
+		ExecLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "netd",
+			Name:      "exec_command_duration_seconds",
+			Help:      "Latency of a single Exec command round-trip.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"vendor", "mode"}),
+		PatternMatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "netd",
+			Name:      "pattern_matches_total",
+			Help:      "Number of prompt/err pattern matches, by kind.",
+		}, []string{"kind"}),
+		SemaWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "netd",
+			Name:      "sema_wait_seconds",
+			Help:      "Time spent waiting to acquire a per-address connection semaphore.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}
+	reg.MustRegister(m.OpenConnections, m.HeartbeatFailures, m.ExecLatency, m.PatternMatches, m.SemaWait)
+	return m
+}
+
+// ListenAndServe exposes gatherer's collectors at addr's "/metrics" path.
+func ListenAndServe(addr string, gatherer prometheus.Gatherer) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	return http.ListenAndServe(addr, mux)
+}
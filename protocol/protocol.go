@@ -0,0 +1,73 @@
+// Package protocol defines the wire format netd uses to describe a CLI
+// request to a network device.
+package protocol
+
+import "time"
+
+// CliRequest describes a single CLI session request: which device to reach,
+// how to authenticate, and what to run once connected.
+type CliRequest struct {
+	LogPrefix string
+	// ReqID identifies this request for log correlation. LogPrefix remains
+	// for backwards compatibility but is free-form and not indexable.
+	ReqID    string
+	Device   string
+	Address  string
+	Protocol string
+	Mode     string
+	Commands []string
+	Timeout  time.Duration
+	Auth     *Auth
+
+	// Proxy is a chain of SSH jump hosts to dial through before reaching
+	// Address, for devices only reachable via a bastion. Proxy[0] is dialed
+	// directly; each subsequent entry is dialed through the previous one,
+	// and Address is finally reached through the last entry.
+	Proxy []*Proxy
+}
+
+// CliChunk is one piece of streamed command output from
+// (*conn.CliConn).ExecStream: either a partial read of Cmd's output, or the
+// terminal event for Cmd once its prompt has matched, it was interrupted, or
+// reading it failed.
+type CliChunk struct {
+	Cmd  string
+	Data string
+	Done bool
+	Err  string
+}
+
+// Proxy describes one SSH jump host in a ProxyJump chain.
+type Proxy struct {
+	Address string
+	// Protocol is the transport used to reach this hop. Only "ssh" (or
+	// unset, which defaults to it) is supported, since jump hosts are
+	// themselves dialed as SSH clients to carry the chain to the next hop.
+	Protocol string
+	Auth     *Auth
+}
+
+// Auth carries the credentials and host-key verification settings for an SSH
+// or telnet session. Password, PrivateKey and AgentSocket are tried in that
+// order; whichever are non-empty are offered to the server.
+type Auth struct {
+	Username string
+	Password string
+
+	// PrivateKey is a PEM-encoded private key used for SSH public-key auth.
+	PrivateKey string
+	// Passphrase decrypts PrivateKey when it is encrypted.
+	Passphrase string
+	// AgentSocket is a path to an SSH_AUTH_SOCK to dial for agent auth.
+	AgentSocket string
+
+	// KnownHostsFile, when set, verifies the server host key against it.
+	KnownHostsFile string
+	// Fingerprint, when set, pins the expected SHA256 host key fingerprint
+	// (e.g. "SHA256:..."). Used when no KnownHostsFile is available.
+	Fingerprint string
+	// StrictHostKey requires KnownHostsFile or Fingerprint to be set;
+	// when false, host key verification falls back to allow-any so
+	// operators can migrate gradually.
+	StrictHostKey bool
+}
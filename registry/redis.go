@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// keyPrefix namespaces connection-ownership locks in the shared Redis
+// instance so they don't collide with other uses of the same database.
+const keyPrefix = "netd:lock:"
+
+// heartbeatScript atomically extends key's TTL only if it's still held by
+// owner, so a lease that expires between a Get and a follow-up EXPIRE can't
+// cause this node to extend a lock another node has since acquired.
+var heartbeatScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript atomically deletes key only if it's still held by owner, so
+// a lease that expires between a Get and a follow-up DEL can't cause this
+// node to delete a lock another node has since acquired.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Redis is a Registry backed by Redis, so connection ownership is shared
+// across every netd instance pointed at the same database. Acquire is a
+// Redlock-style SET NX PX; Heartbeat refreshes the same key's TTL as long as
+// this node still owns it.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis returns a Registry backed by the given Redis client.
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+// Acquire implements Registry.
+func (r *Redis) Acquire(address, owner string, lease time.Duration) (bool, string, error) {
+	ctx := context.Background()
+	key := keyPrefix + address
+	ok, err := r.client.SetNX(ctx, key, owner, lease).Result()
+	if err != nil {
+		return false, "", err
+	}
+	if ok {
+		return true, owner, nil
+	}
+	current, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// lock expired between SetNX and Get; retry once.
+		ok, err = r.client.SetNX(ctx, key, owner, lease).Result()
+		if err != nil {
+			return false, "", err
+		}
+		if ok {
+			return true, owner, nil
+		}
+		// another node took it first; report who holds it now.
+		current, err = r.client.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			return false, "", err
+		}
+		return false, current, nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if current == owner {
+		return true, owner, nil
+	}
+	return false, current, nil
+}
+
+// Heartbeat implements Registry.
+func (r *Redis) Heartbeat(address, owner string, lease time.Duration) error {
+	ctx := context.Background()
+	key := keyPrefix + address
+	extended, err := heartbeatScript.Run(ctx, r.client, []string{key}, owner, lease.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// Release implements Registry.
+func (r *Redis) Release(address, owner string) error {
+	ctx := context.Background()
+	key := keyPrefix + address
+	return releaseScript.Run(ctx, r.client, []string{key}, owner).Err()
+}
@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis, %s", err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedis(client), mr
+}
+
+func TestRedisAcquireReleaseRoundTrip(t *testing.T) {
+	r, _ := newTestRedis(t)
+
+	ok, owner, err := r.Acquire("10.0.0.1", "node-a", time.Minute)
+	if err != nil || !ok || owner != "node-a" {
+		t.Fatalf("Acquire = %v, %q, %v, want true, node-a, nil", ok, owner, err)
+	}
+
+	// a second node is refused while node-a holds the lease.
+	ok, owner, err = r.Acquire("10.0.0.1", "node-b", time.Minute)
+	if err != nil || ok || owner != "node-a" {
+		t.Fatalf("Acquire by node-b = %v, %q, %v, want false, node-a, nil", ok, owner, err)
+	}
+
+	if err := r.Release("10.0.0.1", "node-a"); err != nil {
+		t.Fatalf("Release error, %s", err)
+	}
+
+	// now node-b can acquire it.
+	ok, owner, err = r.Acquire("10.0.0.1", "node-b", time.Minute)
+	if err != nil || !ok || owner != "node-b" {
+		t.Fatalf("Acquire by node-b after release = %v, %q, %v, want true, node-b, nil", ok, owner, err)
+	}
+}
+
+// TestRedisHeartbeatDoesNotExtendAnotherOwnersLease reproduces the TOCTOU
+// this registry must avoid: node-a's lease expires, node-b acquires the now
+// free lock, and node-a's stale Heartbeat call must not clobber node-b's
+// lease (it must instead report ErrNotOwner).
+func TestRedisHeartbeatDoesNotExtendAnotherOwnersLease(t *testing.T) {
+	r, mr := newTestRedis(t)
+
+	if ok, _, err := r.Acquire("10.0.0.1", "node-a", time.Millisecond); err != nil || !ok {
+		t.Fatalf("initial Acquire = %v, %v", ok, err)
+	}
+	mr.FastForward(5 * time.Millisecond) // let node-a's lease lapse
+
+	if ok, owner, err := r.Acquire("10.0.0.1", "node-b", time.Minute); err != nil || !ok || owner != "node-b" {
+		t.Fatalf("node-b Acquire after expiry = %v, %q, %v, want true, node-b, nil", ok, owner, err)
+	}
+
+	if err := r.Heartbeat("10.0.0.1", "node-a", time.Minute); err != ErrNotOwner {
+		t.Fatalf("stale Heartbeat error = %v, want ErrNotOwner", err)
+	}
+
+	// node-b's lease must be untouched by node-a's stale heartbeat.
+	if ok, owner, err := r.Acquire("10.0.0.1", "node-c", time.Minute); err != nil || ok || owner != "node-b" {
+		t.Fatalf("Acquire by node-c = %v, %q, %v, want false, node-b, nil", ok, owner, err)
+	}
+}
+
+// TestRedisReleaseDoesNotDeleteAnotherOwnersLock mirrors the Heartbeat case
+// for Release: a stale Release from the lease's former owner must not
+// delete a lock a different node has since acquired.
+func TestRedisReleaseDoesNotDeleteAnotherOwnersLock(t *testing.T) {
+	r, mr := newTestRedis(t)
+
+	if ok, _, err := r.Acquire("10.0.0.1", "node-a", time.Millisecond); err != nil || !ok {
+		t.Fatalf("initial Acquire = %v, %v", ok, err)
+	}
+	mr.FastForward(5 * time.Millisecond)
+
+	if ok, _, err := r.Acquire("10.0.0.1", "node-b", time.Minute); err != nil || !ok {
+		t.Fatalf("node-b Acquire after expiry = %v, %v", ok, err)
+	}
+
+	if err := r.Release("10.0.0.1", "node-a"); err != nil {
+		t.Fatalf("stale Release error, %s", err)
+	}
+
+	if ok, owner, err := r.Acquire("10.0.0.1", "node-c", time.Minute); err != nil || ok || owner != "node-b" {
+		t.Fatalf("Acquire by node-c = %v, %q, %v, want false, node-b, nil", ok, owner, err)
+	}
+}
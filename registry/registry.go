@@ -0,0 +1,84 @@
+// Package registry tracks which node owns the active connection to a given
+// device address, so "one active request per device" holds across a fleet
+// of netd instances rather than just inside one process.
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Registry owns the connection-ownership bookkeeping for device addresses.
+// Acquire claims ownership (or confirms this node already owns it), and
+// Heartbeat refreshes the lease so the claim doesn't expire while the
+// connection is still alive.
+type Registry interface {
+	// Acquire claims address for owner. ok is true if owner now holds (or
+	// already held) the connection; otherwise currentOwner names who does.
+	Acquire(address, owner string, lease time.Duration) (ok bool, currentOwner string, err error)
+	// Heartbeat refreshes owner's lease on address. It fails if owner no
+	// longer holds the lease.
+	Heartbeat(address, owner string, lease time.Duration) error
+	// Release gives up owner's claim on address, if held.
+	Release(address, owner string) error
+}
+
+// ErrNotOwner is returned by Heartbeat when the caller's lease was lost,
+// e.g. because it expired and another node acquired it first.
+var ErrNotOwner = fmt.Errorf("registry: caller is not the current owner")
+
+// entry is the bookkeeping kept per address by InMemory.
+type entry struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// InMemory is the default Registry: connection ownership only needs to be
+// tracked within this process. Its entries are guarded by a mutex so
+// Acquire/Release/Heartbeat can be called concurrently. The conn package's
+// own connection and semaphore maps are kept separately from it.
+type InMemory struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// NewInMemory returns a ready-to-use in-process Registry.
+func NewInMemory() *InMemory {
+	return &InMemory{entries: make(map[string]entry)}
+}
+
+// Acquire implements Registry.
+func (r *InMemory) Acquire(address, owner string, lease time.Duration) (bool, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if e, ok := r.entries[address]; ok && e.owner != owner && e.expiresAt.After(now) {
+		return false, e.owner, nil
+	}
+	r.entries[address] = entry{owner: owner, expiresAt: now.Add(lease)}
+	return true, owner, nil
+}
+
+// Heartbeat implements Registry.
+func (r *InMemory) Heartbeat(address, owner string, lease time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[address]
+	if !ok || e.owner != owner {
+		return ErrNotOwner
+	}
+	e.expiresAt = time.Now().Add(lease)
+	r.entries[address] = e
+	return nil
+}
+
+// Release implements Registry.
+func (r *InMemory) Release(address, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[address]; ok && e.owner == owner {
+		delete(r.entries, address)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Package stream exposes (*conn.CliConn).ExecStream over a chunked HTTP
+// transport, so external callers can consume streaming command output
+// without needing a bidirectional protocol like WebSocket.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/sky-cloud-tec/netd/protocol"
+)
+
+// Execer streams a command's output to out, matching the signature of
+// (*conn.CliConn).ExecStream.
+type Execer interface {
+	ExecStream(ctx context.Context, out chan<- protocol.CliChunk) error
+}
+
+// Handler returns an http.HandlerFunc that runs c.ExecStream and writes each
+// protocol.CliChunk as a newline-delimited JSON object, flushing after every
+// chunk so the client can consume output as it arrives instead of waiting
+// for the full response. If the client disconnects, r.Context() is
+// cancelled, which causes ExecStream to send c's interrupt sequence and
+// return.
+func Handler(c Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+
+		out := make(chan protocol.CliChunk)
+		execErr := make(chan error, 1)
+		go func() { execErr <- c.ExecStream(r.Context(), out) }()
+
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case chunk := <-out:
+				if err := enc.Encode(chunk); err != nil {
+					return
+				}
+				flusher.Flush()
+			case err := <-execErr:
+				if err != nil {
+					enc.Encode(protocol.CliChunk{Done: true, Err: err.Error()})
+					flusher.Flush()
+				}
+				return
+			}
+		}
+	}
+}